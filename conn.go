@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+func connect(dest net.IP) (net.Conn, error) {
+	raddr := net.IPAddr{
+		IP: dest,
+	}
+	v6 := isIPv6(dest)
+	network := "ip4:1"
+	if v6 {
+		network = "ip6:ipv6-icmp"
+	}
+	var laddr *net.IPAddr
+	if *srcF != "" {
+		src := net.ParseIP(*srcF)
+		if src == nil {
+			return nil, fmt.Errorf("-S: invalid source address %q", *srcF)
+		}
+		laddr = &net.IPAddr{IP: src}
+	}
+	conn, err := net.DialIP(network, laddr, &raddr)
+	if err != nil {
+		return nil, err
+	}
+	if *debugF {
+		err = setSocketDebugOption(conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := setSocketOptions(conn, v6); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func setSocketDebugOption(conn *net.IPConn) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return rc.Control(func(fd uintptr) {
+		syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_DEBUG, 1)
+	})
+}
+
+// setSocketOptions applies the -Q, -T, -M and -B socket options. -Q and -T
+// map onto the same IP_TOS/IP_TTL (or IPV6_TCLASS/IPV6_UNICAST_HOPS) sockopts
+// on every platform zing builds for, so they're set here directly; -M and -B
+// don't have a portable equivalent (IP_MTU_DISCOVER and SO_BINDTODEVICE are
+// Linux-only), so those are handed off to setMTUDiscover/setBindToDevice,
+// which have a real implementation in sockopts_linux.go and a
+// not-supported-here stub in sockopts_other.go.
+func setSocketOptions(conn *net.IPConn, v6 bool) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var optErr error
+	ctrlErr := rc.Control(func(fd uintptr) {
+		if *tosF >= 0 {
+			proto, opt := syscall.IPPROTO_IP, syscall.IP_TOS
+			if v6 {
+				proto, opt = syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+			}
+			optErr = syscall.SetsockoptInt(int(fd), proto, opt, *tosF)
+		}
+		if optErr == nil && *ttlF >= 0 {
+			proto, opt := syscall.IPPROTO_IP, syscall.IP_TTL
+			if v6 {
+				proto, opt = syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS
+			}
+			optErr = syscall.SetsockoptInt(int(fd), proto, opt, *ttlF)
+		}
+		if optErr == nil && *mtuDiscoverF != "" {
+			optErr = setMTUDiscover(fd, v6, *mtuDiscoverF)
+		}
+		if optErr == nil && *bindDevF != "" {
+			optErr = setBindToDevice(fd, *bindDevF)
+		}
+	})
+	if ctrlErr != nil {
+		return ctrlErr
+	}
+	return optErr
+}
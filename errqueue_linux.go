@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkMTUErrQueue drains one extended error (if any) from conn's error
+// queue and, if it's the "fragmentation needed" ICMP response a router sends
+// back for a packet that didn't fit the path MTU under -M do/want, prints
+// the MTU the kernel reported. It never blocks: a socket with nothing
+// queued returns immediately, so it's safe to call after every normal read.
+func checkMTUErrQueue(conn *net.IPConn) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return
+	}
+	oob := make([]byte, 256)
+	var oobn int
+	var recvErr error
+	ctrlErr := rc.Read(func(fd uintptr) bool {
+		_, oobn, _, _, recvErr = unix.Recvmsg(int(fd), nil, oob, unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT)
+		return true
+	})
+	if ctrlErr != nil || recvErr != nil || oobn == 0 {
+		return
+	}
+
+	cmsgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return
+	}
+	for _, cm := range cmsgs {
+		if cm.Header.Level != unix.SOL_IP && cm.Header.Level != unix.SOL_IPV6 {
+			continue
+		}
+		if cm.Header.Type != unix.IP_RECVERR && cm.Header.Type != unix.IPV6_RECVERR {
+			continue
+		}
+		if len(cm.Data) < int(unsafe.Sizeof(unix.SockExtendedErr{})) {
+			continue
+		}
+		ee := (*unix.SockExtendedErr)(unsafe.Pointer(&cm.Data[0]))
+		if ee.Origin == unix.SO_EE_ORIGIN_ICMP && ee.Errno == uint32(unix.EMSGSIZE) {
+			fmt.Fprintf(os.Stderr, "Message too long (mtu = %d)\n", ee.Info)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// checkMTUErrQueue is a no-op on non-Linux platforms, where -M (and so the
+// error queue it populates) isn't supported either; see sockopts_other.go.
+func checkMTUErrQueue(conn *net.IPConn) {}
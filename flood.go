@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// floodBatchSize is how many echo requests a single sendBatch call tries to
+// push through one syscall on platforms that support it.
+const floodBatchSize = 64
+
+// sendBatcher drives the -f flood sender. sendBatch builds and transmits up
+// to n echo requests and returns how many were actually sent.
+type sendBatcher interface {
+	sendBatch(n int) (int, error)
+	Close() error
+}
+
+// floodPing drives transmission in flood mode (-f): unlike pinger, which
+// waits -i seconds between each echo, it fires continuously, batched
+// through sendBatcher, optionally paced to -I packets per second.
+func floodPing(conn net.Conn) {
+	sender, err := newSendBatcher(conn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return
+	}
+	defer sender.Close()
+
+	var interval time.Duration
+	if *rateF > 0 {
+		interval = time.Second / time.Duration(*rateF)
+	}
+
+	for {
+		batch := floodBatchSize
+		if *countF > 0 {
+			remaining := *countF - int(atomic.LoadInt64(&numTransmitted))
+			if remaining <= 0 {
+				break
+			}
+			if remaining < batch {
+				batch = remaining
+			}
+		}
+
+		start := time.Now()
+		sent, err := sender.sendBatch(batch)
+		if sent > 0 {
+			atomic.AddInt64(&numTransmitted, int64(sent))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			break
+		}
+		if *countF > 0 && atomic.LoadInt64(&numReceived) >= int64(*countF) {
+			break
+		}
+		if interval > 0 {
+			if sleepFor := interval*time.Duration(sent) - time.Since(start); sleepFor > 0 {
+				time.Sleep(sleepFor)
+			}
+		}
+	}
+}
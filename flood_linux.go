@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// batchCapable is true on Linux, where sendBatch and the flood receiver are
+// backed by a single sendmmsg(2)/recvmmsg(2) syscall each via
+// golang.org/x/net's PacketConn batch API, instead of one syscall per
+// packet.
+const batchCapable = true
+
+type linuxBatchSender struct {
+	conn *net.IPConn
+	v4   *ipv4.PacketConn
+	v6   *ipv6.PacketConn
+	bufs [][]byte
+}
+
+func newSendBatcher(conn net.Conn) (sendBatcher, error) {
+	ipConn, ok := conn.(*net.IPConn)
+	if !ok {
+		return nil, fmt.Errorf("flood mode requires a raw IP connection")
+	}
+	s := &linuxBatchSender{conn: ipConn}
+	if destIsV6 {
+		s.v6 = ipv6.NewPacketConn(ipConn)
+	} else {
+		s.v4 = ipv4.NewPacketConn(ipConn)
+	}
+	return s, nil
+}
+
+func (s *linuxBatchSender) sendBatch(n int) (int, error) {
+	if cap(s.bufs) < n {
+		s.bufs = make([][]byte, n)
+	}
+	bufs := s.bufs[:n]
+	msgs := make([]ipv4.Message, n)
+	src, dst := pingSrcDst(s.conn)
+	seq := atomic.LoadInt64(&numTransmitted)
+	for i := 0; i < n; i++ {
+		bufs[i] = getPacketBuf()
+		pack := newPacket(uint16(packetID), uint16(seq)+uint16(i), destIsV6)
+		data := pack.buildInto(bufs[i], src, dst)
+		msgs[i] = ipv4.Message{Buffers: [][]byte{data}}
+	}
+
+	var sent int
+	var err error
+	if s.v6 != nil {
+		sent, err = s.v6.WriteBatch(msgs, 0)
+	} else {
+		sent, err = s.v4.WriteBatch(msgs, 0)
+	}
+
+	for i := 0; i < n; i++ {
+		putPacketBuf(bufs[i])
+	}
+	return sent, err
+}
+
+func (s *linuxBatchSender) Close() error {
+	return nil
+}
+
+// recvPingFlood drains replies with a single recvmmsg(2) call per batch
+// instead of one read(2) per packet.
+func recvPingFlood(conn net.Conn, sig chan<- os.Signal) {
+	ipConn := conn.(*net.IPConn)
+	var v4 *ipv4.PacketConn
+	var v6 *ipv6.PacketConn
+	if destIsV6 {
+		v6 = ipv6.NewPacketConn(ipConn)
+		if err := v6.SetControlMessage(ipv6.FlagHopLimit, true); err != nil {
+			fmt.Fprintf(os.Stderr, "error enabling hop limit control messages: %s\n", err)
+		}
+	} else {
+		v4 = ipv4.NewPacketConn(ipConn)
+	}
+
+	bufs := make([][]byte, floodBatchSize)
+	msgs := make([]ipv4.Message, floodBatchSize)
+	for i := range bufs {
+		bufs[i] = make([]byte, recvBufferSize)
+		msgs[i].Buffers = [][]byte{bufs[i]}
+		if destIsV6 {
+			msgs[i].OOB = ipv6.NewControlMessage(ipv6.FlagHopLimit)
+		}
+	}
+
+	for {
+		if err := ipConn.SetReadDeadline(time.Now().Add(readDeadline())); err != nil {
+			fmt.Fprintf(os.Stderr, "deadline error: %s\n", err)
+			continue
+		}
+		var n int
+		var err error
+		if v6 != nil {
+			n, err = v6.ReadBatch(msgs, 0)
+		} else {
+			n, err = v4.ReadBatch(msgs, 0)
+		}
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				fmt.Fprintf(os.Stderr, "Request timeout\n")
+			} else {
+				fmt.Fprintf(os.Stderr, "read error: %s\n", err)
+			}
+			continue
+		}
+		for i := 0; i < n; i++ {
+			if destIsV6 {
+				printReceivedPacketV6(bufs[i], msgs[i].N, conn, hopLimitFromOOB(msgs[i].OOB[:msgs[i].NN]))
+			} else {
+				printReceivedPacketV4(bufs[i], msgs[i].N, conn)
+			}
+		}
+		if doneReceiving() {
+			sig <- syscall.SIGQUIT
+			break
+		}
+	}
+}
+
+func hopLimitFromOOB(oob []byte) int {
+	cm := &ipv6.ControlMessage{}
+	if err := cm.Parse(oob); err != nil {
+		return -1
+	}
+	return cm.HopLimit
+}
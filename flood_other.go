@@ -0,0 +1,69 @@
+//go:build !linux
+
+package main
+
+import (
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// batchCapable is false on non-Linux platforms: there is no portable
+// sendmmsg(2)/recvmmsg(2), so flood mode falls back to a pool of goroutines
+// each issuing individual Writes, and the receiver stays on the regular
+// one-packet-at-a-time path.
+const batchCapable = false
+
+const floodWorkers = 16
+
+type fallbackSender struct {
+	conn net.Conn
+	jobs chan int
+	wg   sync.WaitGroup
+}
+
+func newSendBatcher(conn net.Conn) (sendBatcher, error) {
+	s := &fallbackSender{conn: conn, jobs: make(chan int)}
+	for i := 0; i < floodWorkers; i++ {
+		go s.worker()
+	}
+	return s, nil
+}
+
+func (s *fallbackSender) worker() {
+	for seq := range s.jobs {
+		pack := newPacket(uint16(packetID), uint16(seq), destIsV6)
+		src, dst := pingSrcDst(s.conn)
+		buf := getPacketBuf()
+		data := pack.buildInto(buf, src, dst)
+		s.conn.Write(data)
+		putPacketBuf(buf)
+		s.wg.Done()
+	}
+}
+
+func (s *fallbackSender) sendBatch(n int) (int, error) {
+	seq := int(atomic.LoadInt64(&numTransmitted))
+	s.wg.Add(n)
+	for i := 0; i < n; i++ {
+		s.jobs <- seq + i
+	}
+	s.wg.Wait()
+	return n, nil
+}
+
+func (s *fallbackSender) Close() error {
+	close(s.jobs)
+	return nil
+}
+
+// recvPingFlood only exists so this file compiles; batchCapable is false on
+// this platform so recvPing never actually calls it.
+func recvPingFlood(conn net.Conn, sig chan<- os.Signal) {
+	if destIsV6 {
+		recvPingV6(conn.(*net.IPConn), sig)
+		return
+	}
+	recvPingV4(conn, sig)
+}
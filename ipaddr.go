@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// getIPAddr picks which resolved address zing should dial. When -4 or -6
+// forces a family, only addresses of that family are considered. Otherwise
+// it applies a small RFC 6724-style preference: match the forced family
+// first, then prefer a global address over a link-local one.
+func getIPAddr(addrs []string) (net.IP, error) {
+	var v4, v6Global, v6LinkLocal []net.IP
+	for _, a := range addrs {
+		ip := net.ParseIP(a)
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+			continue
+		}
+		if ip.IsLinkLocalUnicast() {
+			v6LinkLocal = append(v6LinkLocal, ip)
+		} else {
+			v6Global = append(v6Global, ip)
+		}
+	}
+
+	if *sixF {
+		if len(v6Global) > 0 {
+			return v6Global[0], nil
+		}
+		if len(v6LinkLocal) > 0 {
+			return v6LinkLocal[0], nil
+		}
+		return nil, fmt.Errorf("no IPv6 address found")
+	}
+	if *fourF {
+		if len(v4) > 0 {
+			return v4[0], nil
+		}
+		return nil, fmt.Errorf("no IPv4 address found")
+	}
+
+	switch {
+	case len(v6Global) > 0:
+		return v6Global[0], nil
+	case len(v4) > 0:
+		return v4[0], nil
+	case len(v6LinkLocal) > 0:
+		return v6LinkLocal[0], nil
+	}
+	return nil, fmt.Errorf("address not found")
+}
+
+func isIPv6(ip net.IP) bool {
+	return ip.To4() == nil
+}
@@ -1,15 +1,13 @@
 package main
 
 import (
-	"encoding/binary"
-	"errors"
+	"encoding/hex"
 	"flag"
 	"fmt"
-	"math"
-	"math/rand"
 	"net"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -24,8 +22,9 @@ var (
 	packetSize     = defaultPacketSize // the number of  bytes to be sent, the -s flag can change this
 	recvBufferSize = 1024              // buffer size when receiving replies
 	packetID       = 0                 // id for each packet sent
-	numTransmitted = 0                 // number of packets sent
-	numReceived    = 0                 // number of packets received
+	numTransmitted int64               // number of packets sent, touched from the sender and (in flood mode) multiple goroutines
+	numReceived    int64               // number of packets received, touched from the receiver and (in flood mode) multiple goroutines
+	destIsV6       = false             // whether the resolved destination is an IPv6 address
 )
 
 var countF = flag.Int("c", 0, "Stop after sending -c packets")
@@ -34,6 +33,21 @@ var waitF = flag.Int("i", 1, "Wait -i seconds between sending each packet")
 var exitF = flag.Bool("o", false, "Exit successfully after receiving one reply packet")
 var packetSizeF = flag.Int("s", defaultPacketSize, "Specify the number of data bytes to be sent")
 var timeoutF = flag.Int("t", 0, "Timeout, in seconds before zing exits regardless of how many packets have been received")
+var patternF = flag.String("p", "", "Fill the packet payload with the given hex pattern (e.g. -p ff) instead of random bytes")
+var deadlineF = flag.Int("W", 0, "Per-reply read deadline, in seconds (default: 2x -i)")
+var fourF = flag.Bool("4", false, "Force zing to use IPv4")
+var sixF = flag.Bool("6", false, "Force zing to use IPv6")
+var floodF = flag.Bool("f", false, "Flood ping, sending packets as fast as possible (or at the rate set by -I)")
+var rateF = flag.Int("I", 0, "In flood mode, send at most -I packets per second (0 means as fast as possible)")
+var tosF = flag.Int("Q", -1, "Set the DSCP/TOS value on the socket (IP_TOS / IPV6_TCLASS)")
+var ttlF = flag.Int("T", -1, "Set the TTL / hop limit on the socket (IP_TTL / IPV6_UNICAST_HOPS)")
+var mtuDiscoverF = flag.String("M", "", "Set the path MTU discovery mode: do, dont, or want (Linux only)")
+var srcF = flag.String("S", "", "Bind to the given source address")
+var bindDevF = flag.String("B", "", "Bind to the given network interface, SO_BINDTODEVICE (Linux only)")
+
+// outputF picks the output format for a multi-target run. It's spelled -O
+// rather than -o since -o is already taken by exitF.
+var outputF = flag.String("O", "text", "Output format when pinging multiple targets: text or json")
 
 var transmissionTimes []float64
 
@@ -48,39 +62,72 @@ func main() {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
-	if len(flag.Args()) > 1 {
-		fmt.Fprintf(os.Stderr, "zing: only 1 destination must be specified\n")
-		flag.PrintDefaults()
+	if *fourF && *sixF {
+		fmt.Fprintf(os.Stderr, "zing: -4 and -6 cannot be used together\n")
 		os.Exit(1)
 	}
-	destination := flag.Args()[0]
-	addrs, err := net.LookupHost(destination)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "zing: lookup for %s failed\n", destination)
+	if *rateF > 0 && !*floodF {
+		fmt.Fprintf(os.Stderr, "zing: -I can only be used with -f\n")
 		os.Exit(1)
 	}
-	if len(addrs) == 0 {
-		fmt.Fprintf(os.Stderr, "zing: no addresses were found for %s\n", destination)
+	if *outputF != "text" && *outputF != "json" {
+		fmt.Fprintf(os.Stderr, "zing: -O must be either \"text\" or \"json\"\n")
 		os.Exit(1)
 	}
-	solvedDest, err := getIPAddr(addrs)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "zing: error resolving address: %s\n", err)
+	if *mtuDiscoverF != "" && *mtuDiscoverF != "do" && *mtuDiscoverF != "dont" && *mtuDiscoverF != "want" {
+		fmt.Fprintf(os.Stderr, "zing: -M must be one of \"do\", \"dont\" or \"want\"\n")
 		os.Exit(1)
 	}
-	conn, err := connect(solvedDest)
+	if *patternF != "" {
+		pattern, err := hex.DecodeString(*patternF)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "zing: -p must be a valid hex pattern: %s\n", err)
+			os.Exit(1)
+		}
+		fillPattern = pattern
+	}
+
+	targets, err := resolveTargets(flag.Args())
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "zing: error connecting: %s\n", err)
+		fmt.Fprintf(os.Stderr, "zing: %s\n", err)
 		os.Exit(1)
 	}
 
+	packetSize = defaultPacketSize
 	if *packetSizeF != defaultPacketSize {
 		packetSize = *packetSizeF
 	}
+	packetID = os.Getpid() & 0xffff
+
+	if len(targets) == 1 {
+		runSingleTarget(targets[0])
+		return
+	}
+	if *floodF {
+		fmt.Fprintf(os.Stderr, "zing: -f flood mode only supports a single target\n")
+		os.Exit(1)
+	}
+	if *tosF >= 0 || *ttlF >= 0 || *mtuDiscoverF != "" || *srcF != "" || *bindDevF != "" {
+		fmt.Fprintf(os.Stderr, "zing: -Q, -T, -M, -S and -B only support a single target\n")
+		os.Exit(1)
+	}
+	runMultiTarget(targets)
+}
+
+// runSingleTarget is the original zing: one destination, one connected raw
+// socket, one set of global counters.
+func runSingleTarget(t *target) {
+	destIsV6 = t.isV6
+	conn, err := connect(t.ip)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "zing: error connecting: %s\n", err)
+		os.Exit(1)
+	}
 
 	transmissionTimes = make([]float64, 0, 15) // arbitrary value
-	packetID = os.Getpid() & 0xffff
-	printPingMessage(destination, solvedDest)
+	if *outputF != "json" {
+		printPingMessage(t.label, t.ip)
+	}
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGQUIT)
 	go pinger(conn)
@@ -91,56 +138,7 @@ func main() {
 	}
 
 	<-sig
-	printStats(destination)
-}
-
-type packet struct {
-	pType    uint8
-	code     uint8
-	checksum uint16
-	id       uint16
-	seqNum   uint16
-	data     []byte
-}
-
-func newPacket(id uint16, seq uint16) *packet {
-	return &packet{
-		pType:  uint8(8),
-		code:   uint8(0),
-		id:     id,
-		seqNum: seq,
-		data:   nil,
-	}
-}
-
-func (p *packet) buildData() []byte {
-	pData := make([]byte, icmpHeaderSize+packetSize)
-	pData[0], pData[1] = byte(p.pType), byte(p.code)       // type and code
-	pData[2], pData[3] = byte(0), byte(0)                  // checksum
-	pData[4], pData[5] = byte(p.id>>8), byte(p.id)         // id
-	pData[6], pData[7] = byte(p.seqNum>>8), byte(p.seqNum) // seq number
-
-	garbageDataIdx := icmpHeaderSize
-	packSize := packetSize
-
-	// store the timestamp if we can
-	if packSize >= 8 {
-		b := binary.PutVarint(pData[garbageDataIdx:], time.Now().UnixNano())
-		packSize -= b
-		garbageDataIdx += b
-	}
-
-	// build packet data
-	rand.Seed(time.Now().UnixNano())
-	for i := garbageDataIdx; i < packSize; i++ {
-		pData[i] = byte(rand.Intn(127))
-	}
-	p.data = pData[icmpHeaderSize:]
-	csum := calculateChecksum(pData)
-	p.checksum = csum
-	pData[2], pData[3] = byte(csum&255), byte(csum>>8)
-
-	return pData
+	printStats(t.label, t.ip)
 }
 
 func printPingMessage(destination string, solvedDest net.IP) {
@@ -151,6 +149,15 @@ func printPingMessage(destination string, solvedDest net.IP) {
 	fmt.Fprintf(os.Stdout, " %d bytes of data.\n", packetSize)
 }
 
+// readDeadline is the per-reply read deadline used by every receiver: -W
+// when given, otherwise the previous default of twice -i.
+func readDeadline() time.Duration {
+	if *deadlineF > 0 {
+		return time.Duration(*deadlineF) * time.Second
+	}
+	return time.Duration(*waitF*2) * time.Second
+}
+
 func timeout(sig chan os.Signal) {
 	select {
 	case <-time.After(time.Duration(*timeoutF) * time.Second):
@@ -159,187 +166,45 @@ func timeout(sig chan os.Signal) {
 }
 
 func pinger(conn net.Conn) {
+	if *floodF {
+		floodPing(conn)
+		return
+	}
 	for {
 		if err := sendPingPacket(conn); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %s\n", err)
 			break
 		}
 		time.Sleep(time.Duration(*waitF) * time.Second)
-		if *countF > 0 && numReceived >= *countF {
+		if *countF > 0 && atomic.LoadInt64(&numReceived) >= int64(*countF) {
 			break
 		}
 	}
 }
 
-func connect(dest net.IP) (net.Conn, error) {
-	raddr := net.IPAddr{
-		IP: dest,
+func pingSrcDst(conn net.Conn) (src net.IP, dst net.IP) {
+	if !destIsV6 {
+		return nil, nil
 	}
-	conn, err := net.DialIP("ip4:1", nil, &raddr)
-	if err != nil {
-		return nil, err
+	if laddr, ok := conn.LocalAddr().(*net.IPAddr); ok {
+		src = laddr.IP
 	}
-	if *debugF {
-		err = setSocketDebugOption(conn)
-		if err != nil {
-			return nil, err
-		}
+	if raddr, ok := conn.RemoteAddr().(*net.IPAddr); ok {
+		dst = raddr.IP
 	}
-	return conn, nil
-}
-
-func getIPAddr(addrs []string) (net.IP, error) {
-	for _, a := range addrs {
-		ip := net.ParseIP(a)
-		if ip != nil && ip.To4() != nil {
-			return ip, nil
-		}
-	}
-	return nil, fmt.Errorf("address not found")
+	return src, dst
 }
 
 func sendPingPacket(conn net.Conn) error {
-	pack := newPacket(uint16(packetID), uint16(numTransmitted))
-	_, err := conn.Write(pack.buildData())
-	if err != nil {
+	seq := atomic.LoadInt64(&numTransmitted)
+	pack := newPacket(uint16(packetID), uint16(seq), destIsV6)
+	src, dst := pingSrcDst(conn)
+	buf := getPacketBuf()
+	defer putPacketBuf(buf)
+	data := pack.buildInto(buf, src, dst)
+	if _, err := conn.Write(data); err != nil {
 		return err
 	}
-	numTransmitted++
+	atomic.AddInt64(&numTransmitted, 1)
 	return nil
 }
-
-func recvPing(conn net.Conn, sig chan<- os.Signal) {
-	// this will receive the reply messages from the echo requests
-	buf := make([]byte, recvBufferSize)
-	for {
-		if err := conn.SetReadDeadline(time.Now().Add(time.Duration((*waitF * 2)) * time.Second)); err != nil {
-			fmt.Fprintf(os.Stderr, "deadline error: %s\n", err)
-			continue
-		}
-		b, err := conn.Read(buf)
-		if err != nil {
-			if errors.Is(err, os.ErrDeadlineExceeded) {
-				fmt.Fprintf(os.Stderr, "Request timeout\n")
-			} else {
-				fmt.Fprintf(os.Stderr, "read error: %s\n", err)
-			}
-			continue
-		}
-		printReceivedPacket(buf, b, conn)
-		if (*countF > 0 && numReceived >= *countF) || (*exitF && numReceived >= 1) {
-			sig <- syscall.SIGQUIT
-			break
-		}
-	}
-}
-
-func printReceivedPacket(buf []byte, bytesRead int, conn net.Conn) {
-	id := getPacketID(buf)
-	// do nothing since this packet does not belong to this process
-	if int(id) != packetID {
-		return
-	}
-	numReceived++
-	bLen := bytesRead - ipHeaderSize
-	raddr := conn.RemoteAddr().String()
-	seq := getPacketSeqNum(buf)
-	ttl := buf[8]
-	fmt.Printf("%d bytes from %s: icmp_seq=%d ttl=%d", bLen, raddr, seq, int(ttl))
-	packTime, err := calculatePacketTime(buf)
-	if err == nil {
-		fmt.Printf(" time=%s\n", fmt.Sprintf("%.3fms", packTime))
-		transmissionTimes = append(transmissionTimes, packTime)
-	}
-}
-
-func printStats(destination string) {
-	fmt.Println()
-	fmt.Printf("--- %s ping statistics ---\n", destination)
-	fmt.Printf("%d packets transmitted, %d packets received, %.2f%% packet loss\n", numTransmitted, numReceived, calculatePacketLoss())
-	min, max, avg, stddev := calculateAverages()
-	fmt.Printf("round-trip min/max/avg/stddev = %.3f/%.3f/%.3f/%.3f ms\n", min, max, avg, stddev)
-}
-
-func calculatePacketLoss() float64 {
-	return float64((numTransmitted - numReceived) * 100 / numTransmitted)
-}
-
-func calculateAverages() (float64, float64, float64, float64) {
-	var min, max, avg, stddev float64
-	if len(transmissionTimes) == 0 {
-		return min, max, avg, stddev
-	}
-
-	min = transmissionTimes[0]
-	max = transmissionTimes[0]
-	var sum float64
-	for _, t := range transmissionTimes {
-		sum += t
-		if t < min {
-			min = t
-		}
-		if t > max {
-			max = t
-		}
-	}
-	avg = sum / float64(numReceived)
-
-	// calculate standard deviation
-	var variance float64
-	for _, t := range transmissionTimes {
-		diff := t - avg
-		diff = diff * diff
-		variance += diff
-	}
-	stddev = math.Sqrt(variance / float64(numReceived))
-	return min, max, avg, stddev
-}
-
-func getPacketID(buf []byte) uint16 {
-	packID := buf[24:26]
-	id := uint16(packID[0]) << 8
-	id |= uint16(packID[1])
-	return id & 0xffff
-}
-
-func getPacketSeqNum(buf []byte) uint16 {
-	seqNum := buf[26:28]
-	num := uint16(seqNum[0]) << 8
-	num |= uint16(seqNum[1])
-	return num
-}
-
-func calculatePacketTime(buf []byte) (float64, error) {
-	tsBytes := buf[28:37]
-	n, v := binary.Varint(tsBytes)
-	if v <= 0 {
-		return 0.0, fmt.Errorf("error decoding the timestamp: %d", v)
-	}
-	now := time.Now().UnixNano()
-	ms := now - n
-	return float64(ms) / 1000000.00, nil
-}
-
-func setSocketDebugOption(conn *net.IPConn) error {
-	rc, err := conn.SyscallConn()
-	if err != nil {
-		return err
-	}
-	return rc.Control(func(fd uintptr) {
-		syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_DEBUG, 1)
-	})
-}
-
-func calculateChecksum(b []byte) uint16 {
-	csumcv := len(b) - 1 // checksum coverage
-	s := uint32(0)
-	for i := 0; i < csumcv; i += 2 {
-		s += uint32(b[i+1])<<8 | uint32(b[i])
-	}
-	if csumcv&1 == 0 {
-		s += uint32(b[csumcv])
-	}
-	s = s>>16 + s&0xffff
-	s = s + s>>16
-	return ^uint16(s)
-}
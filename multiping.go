@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// multiSocket holds the one raw socket per address family that every
+// target of the same family shares; replies are demultiplexed by source
+// address (see recvMulti) instead of each target dialing its own socket.
+type multiSocket struct {
+	v4 *net.IPConn
+	v6 *net.IPConn
+}
+
+func dialMultiSocket(targets []*target) (*multiSocket, error) {
+	var needV4, needV6 bool
+	for _, t := range targets {
+		if t.isV6 {
+			needV6 = true
+		} else {
+			needV4 = true
+		}
+	}
+	ms := &multiSocket{}
+	if needV4 {
+		conn, err := net.ListenIP("ip4:1", &net.IPAddr{})
+		if err != nil {
+			return nil, err
+		}
+		ms.v4 = conn
+	}
+	if needV6 {
+		conn, err := net.ListenIP("ip6:ipv6-icmp", &net.IPAddr{})
+		if err != nil {
+			return nil, err
+		}
+		ms.v6 = conn
+	}
+	return ms, nil
+}
+
+func (ms *multiSocket) Close() {
+	if ms.v4 != nil {
+		ms.v4.Close()
+	}
+	if ms.v6 != nil {
+		ms.v6.Close()
+	}
+}
+
+// runMultiTarget pings every target in targets concurrently: each target
+// gets its own sender goroutine, while one shared receiver goroutine per
+// address family demultiplexes replies by source address and feeds them
+// back into the matching target.
+func runMultiTarget(targets []*target) {
+	sock, err := dialMultiSocket(targets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "zing: error opening socket: %s\n", err)
+		os.Exit(1)
+	}
+	defer sock.Close()
+
+	v4Targets := make(map[string]*target)
+	v6Targets := make(map[string]*target)
+	for _, t := range targets {
+		if t.isV6 {
+			v6Targets[t.ip.String()] = t
+		} else {
+			v4Targets[t.ip.String()] = t
+		}
+		if *outputF != "json" {
+			fmt.Printf("PING %s (%s) %d bytes of data.\n", t.label, t.ip, packetSize)
+		}
+	}
+
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	closeStop := func() { stopOnce.Do(func() { close(stop) }) }
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGQUIT)
+	go func() {
+		<-sig
+		closeStop()
+	}()
+	if *timeoutF > 0 {
+		go func() {
+			select {
+			case <-time.After(time.Duration(*timeoutF) * time.Second):
+				closeStop()
+			case <-stop:
+			}
+		}()
+	}
+
+	var recvWg sync.WaitGroup
+	if sock.v4 != nil {
+		recvWg.Add(1)
+		go func() {
+			defer recvWg.Done()
+			recvMulti(sock.v4, v4Targets, stop)
+		}()
+	}
+	if sock.v6 != nil {
+		recvWg.Add(1)
+		go func() {
+			defer recvWg.Done()
+			recvMulti(sock.v6, v6Targets, stop)
+		}()
+	}
+
+	var sendWg sync.WaitGroup
+	for _, t := range targets {
+		sendWg.Add(1)
+		go func(t *target) {
+			defer sendWg.Done()
+			pingTarget(sock, t, stop)
+		}(t)
+	}
+
+	sendWg.Wait()
+	closeStop()
+	recvWg.Wait()
+
+	printMultiResults(targets)
+}
+
+func pingTarget(sock *multiSocket, t *target, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err := sendToTarget(sock, t); err != nil {
+			fmt.Fprintf(os.Stderr, "error pinging %s: %s\n", t.label, err)
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Duration(*waitF) * time.Second):
+		}
+		if *countF > 0 && atomic.LoadInt64(&t.received) >= int64(*countF) {
+			return
+		}
+	}
+}
+
+func sendToTarget(sock *multiSocket, t *target) error {
+	seq := atomic.LoadInt64(&t.sent)
+	pack := newPacket(uint16(packetID), uint16(seq), t.isV6)
+	buf := getPacketBuf()
+	defer putPacketBuf(buf)
+	// The pseudo-header source address is left unset: this socket isn't
+	// connected to a single peer, so the kernel (not us) fills in the
+	// correct ICMPv6 checksum at send time based on the route it picks.
+	data := pack.buildInto(buf, nil, nil)
+	raddr := &net.IPAddr{IP: t.ip}
+	var err error
+	if t.isV6 {
+		_, err = sock.v6.WriteToIP(data, raddr)
+	} else {
+		_, err = sock.v4.WriteToIP(data, raddr)
+	}
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&t.sent, 1)
+	return nil
+}
+
+func recvMulti(conn *net.IPConn, targets map[string]*target, stop <-chan struct{}) {
+	buf := make([]byte, recvBufferSize)
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(readDeadline())); err != nil {
+			continue
+		}
+		n, raddr, err := conn.ReadFromIP(buf)
+		if err != nil {
+			continue
+		}
+		t, ok := targets[raddr.IP.String()]
+		if !ok {
+			continue
+		}
+
+		var id, seq uint16
+		var bLen int
+		var packTime float64
+		var perr error
+		if t.isV6 {
+			id = getPacketIDV6(buf)
+			seq = getPacketSeqNumV6(buf)
+			bLen = n
+			packTime, perr = calculatePacketTime(buf[:n], icmpHeaderSize)
+		} else {
+			ihl := ipHeaderLen(buf)
+			id = getPacketID(buf, ihl)
+			seq = getPacketSeqNum(buf, ihl)
+			bLen = n - ihl
+			packTime, perr = calculatePacketTime(buf[:n], ihl+icmpHeaderSize)
+		}
+		if int(id) != packetID {
+			continue
+		}
+
+		atomic.AddInt64(&t.received, 1)
+		if *outputF != "json" {
+			fmt.Printf("%d bytes from %s (%s): icmp_seq=%d", bLen, t.label, t.ip, seq)
+			if perr == nil {
+				fmt.Printf(" time=%.3fms\n", packTime)
+			} else {
+				fmt.Println()
+			}
+		}
+		if perr == nil {
+			t.timesMu.Lock()
+			t.times = append(t.times, packTime)
+			t.timesMu.Unlock()
+		}
+	}
+}
+
+func printMultiResults(targets []*target) {
+	if *outputF == "json" {
+		for _, t := range targets {
+			fmt.Println(targetJSON(t))
+		}
+		return
+	}
+
+	var totalSent, totalReceived int64
+	var allTimes []float64
+	for _, t := range targets {
+		sent := atomic.LoadInt64(&t.sent)
+		received := atomic.LoadInt64(&t.received)
+		totalSent += sent
+		totalReceived += received
+
+		t.timesMu.Lock()
+		times := append([]float64(nil), t.times...)
+		t.timesMu.Unlock()
+		allTimes = append(allTimes, times...)
+
+		fmt.Printf("\n--- %s ping statistics ---\n", t.label)
+		fmt.Printf("%d packets transmitted, %d packets received, %.2f%% packet loss\n", sent, received, lossPct(sent, received))
+		min, max, avg, stddev := summarizeRTTs(times)
+		fmt.Printf("round-trip min/max/avg/stddev = %.3f/%.3f/%.3f/%.3f ms\n", min, max, avg, stddev)
+	}
+
+	fmt.Printf("\n--- aggregate ping statistics ---\n")
+	fmt.Printf("%d packets transmitted, %d packets received, %.2f%% packet loss\n", totalSent, totalReceived, lossPct(totalSent, totalReceived))
+	min, max, avg, stddev := summarizeRTTs(allTimes)
+	fmt.Printf("round-trip min/max/avg/stddev = %.3f/%.3f/%.3f/%.3f ms\n", min, max, avg, stddev)
+}
+
+func lossPct(sent int64, received int64) float64 {
+	if sent == 0 {
+		return 0
+	}
+	return float64((sent-received)*100) / float64(sent)
+}
+
+func summarizeRTTs(times []float64) (min, max, avg, stddev float64) {
+	if len(times) == 0 {
+		return
+	}
+	min, max = times[0], times[0]
+	var sum float64
+	for _, t := range times {
+		sum += t
+		if t < min {
+			min = t
+		}
+		if t > max {
+			max = t
+		}
+	}
+	avg = sum / float64(len(times))
+	var variance float64
+	for _, t := range times {
+		d := t - avg
+		variance += d * d
+	}
+	stddev = math.Sqrt(variance / float64(len(times)))
+	return
+}
+
+type targetResult struct {
+	Destination string    `json:"destination"`
+	ResolvedIP  string    `json:"resolved_ip"`
+	Sent        int64     `json:"sent"`
+	Received    int64     `json:"received"`
+	LossPct     float64   `json:"loss_pct"`
+	RTTMinMs    float64   `json:"rtt_min_ms"`
+	RTTMaxMs    float64   `json:"rtt_max_ms"`
+	RTTAvgMs    float64   `json:"rtt_avg_ms"`
+	RTTStddevMs float64   `json:"rtt_stddev_ms"`
+	RTTs        []float64 `json:"rtts"`
+}
+
+func targetJSON(t *target) string {
+	sent := atomic.LoadInt64(&t.sent)
+	received := atomic.LoadInt64(&t.received)
+	t.timesMu.Lock()
+	times := append([]float64(nil), t.times...)
+	t.timesMu.Unlock()
+	min, max, avg, stddev := summarizeRTTs(times)
+
+	r := targetResult{
+		Destination: t.label,
+		ResolvedIP:  t.ip.String(),
+		Sent:        sent,
+		Received:    received,
+		LossPct:     lossPct(sent, received),
+		RTTMinMs:    min,
+		RTTMaxMs:    max,
+		RTTAvgMs:    avg,
+		RTTStddevMs: stddev,
+		RTTs:        times,
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Sprintf(`{"destination":%q,"error":%q}`, t.label, err.Error())
+	}
+	return string(b)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	icmpv4EchoRequest = 8
+	icmpv6EchoRequest = 128
+	icmpv6NextHeader  = 58 // ICMPv6, used in the IPv6 pseudo-header
+	timestampSize     = 8  // size, in bytes, of the UnixNano timestamp at payload offset 0
+)
+
+// fillPattern holds the decoded bytes of -p, used to pad packets past the
+// timestamp instead of the default random filler. It's set once in main.
+var fillPattern []byte
+
+// packetBufPool lets flood mode (and the regular sender) reuse packet
+// buffers across sends instead of allocating one per echo request.
+var packetBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, icmpHeaderSize+packetSize)
+		return &b
+	},
+}
+
+func getPacketBuf() []byte {
+	return *(packetBufPool.Get().(*[]byte))
+}
+
+func putPacketBuf(b []byte) {
+	packetBufPool.Put(&b)
+}
+
+type packet struct {
+	pType    uint8
+	code     uint8
+	checksum uint16
+	id       uint16
+	seqNum   uint16
+	v6       bool
+	data     []byte
+}
+
+func newPacket(id uint16, seq uint16, v6 bool) *packet {
+	pType := uint8(icmpv4EchoRequest)
+	if v6 {
+		pType = uint8(icmpv6EchoRequest)
+	}
+	return &packet{
+		pType:  pType,
+		code:   uint8(0),
+		id:     id,
+		seqNum: seq,
+		v6:     v6,
+		data:   nil,
+	}
+}
+
+// buildData assembles the raw ICMP packet into a freshly pooled buffer. src
+// and dst are only used to build the IPv6 pseudo-header required by RFC
+// 4443; they are ignored when building an ICMPv4 packet, since ICMPv4 has
+// no pseudo-header. The caller is responsible for returning the buffer to
+// the pool with putPacketBuf once it is done with it (see sendPingPacket
+// and the flood batch sender).
+func (p *packet) buildData(src net.IP, dst net.IP) []byte {
+	pData := getPacketBuf()
+	return p.buildInto(pData, src, dst)
+}
+
+// buildInto is the same as buildData but fills a caller-supplied buffer,
+// letting the flood batch sender build many packets without allocating or
+// round-tripping through the pool once per packet.
+func (p *packet) buildInto(pData []byte, src net.IP, dst net.IP) []byte {
+	pData[0], pData[1] = byte(p.pType), byte(p.code)       // type and code
+	pData[2], pData[3] = byte(0), byte(0)                  // checksum
+	pData[4], pData[5] = byte(p.id>>8), byte(p.id)         // id
+	pData[6], pData[7] = byte(p.seqNum>>8), byte(p.seqNum) // seq number
+
+	// The payload always starts with an 8-byte timestamp (so RTT can be
+	// computed on receipt) followed by filler out to packetSize bytes.
+	payload := pData[icmpHeaderSize:]
+	if len(payload) >= timestampSize {
+		binary.BigEndian.PutUint64(payload[:timestampSize], uint64(time.Now().UnixNano()))
+		fillPayload(payload[timestampSize:])
+	} else {
+		fillPayload(payload)
+	}
+	p.data = payload
+
+	var csum uint16
+	if p.v6 {
+		csum = calculateChecksumV6(src, dst, pData)
+	} else {
+		csum = calculateChecksum(pData)
+	}
+	p.checksum = csum
+	pData[2], pData[3] = byte(csum&255), byte(csum>>8)
+
+	return pData
+}
+
+// fillPayload pads b with the -p hex pattern, repeated to fill it, or with
+// random bytes when no pattern was given.
+func fillPayload(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	if len(fillPattern) > 0 {
+		for i := range b {
+			b[i] = fillPattern[i%len(fillPattern)]
+		}
+		return
+	}
+	rand.Seed(time.Now().UnixNano())
+	for i := range b {
+		b[i] = byte(rand.Intn(127))
+	}
+}
+
+func calculateChecksum(b []byte) uint16 {
+	csumcv := len(b) - 1 // checksum coverage
+	s := uint32(0)
+	for i := 0; i < csumcv; i += 2 {
+		s += uint32(b[i+1])<<8 | uint32(b[i])
+	}
+	if csumcv&1 == 0 {
+		s += uint32(b[csumcv])
+	}
+	s = s>>16 + s&0xffff
+	s = s + s>>16
+	return ^uint16(s)
+}
+
+// calculateChecksumV6 computes the ICMPv6 checksum over the RFC 4443
+// pseudo-header (source address, destination address, upper-layer packet
+// length and next-header) followed by the ICMPv6 message itself.
+func calculateChecksumV6(src net.IP, dst net.IP, icmpData []byte) uint16 {
+	pseudo := make([]byte, 40)
+	copy(pseudo[0:16], src.To16())
+	copy(pseudo[16:32], dst.To16())
+	binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(icmpData)))
+	pseudo[39] = icmpv6NextHeader
+	return calculateChecksum(append(pseudo, icmpData...))
+}
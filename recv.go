@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/ipv6"
+)
+
+func recvPing(conn net.Conn, sig chan<- os.Signal) {
+	if *floodF && batchCapable {
+		recvPingFlood(conn, sig)
+		return
+	}
+	if destIsV6 {
+		recvPingV6(conn.(*net.IPConn), sig)
+		return
+	}
+	recvPingV4(conn, sig)
+}
+
+func recvPingV4(conn net.Conn, sig chan<- os.Signal) {
+	// this will receive the reply messages from the echo requests
+	buf := make([]byte, recvBufferSize)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(readDeadline())); err != nil {
+			fmt.Fprintf(os.Stderr, "deadline error: %s\n", err)
+			continue
+		}
+		b, err := conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				fmt.Fprintf(os.Stderr, "Request timeout\n")
+			} else {
+				fmt.Fprintf(os.Stderr, "read error: %s\n", err)
+			}
+			if *mtuDiscoverF != "" {
+				if ipConn, ok := conn.(*net.IPConn); ok {
+					checkMTUErrQueue(ipConn)
+				}
+			}
+			continue
+		}
+		printReceivedPacketV4(buf, b, conn)
+		if doneReceiving() {
+			sig <- syscall.SIGQUIT
+			break
+		}
+	}
+}
+
+// recvPingV6 reads replies from the raw ICMPv6 socket. Unlike IPv4, the
+// kernel hands us the ICMPv6 message directly with no IP header in front
+// of it, so the hop limit (the IPv6 equivalent of TTL) has to be read out
+// of an IPV6_HOPLIMIT control message instead of an offset in buf.
+func recvPingV6(conn *net.IPConn, sig chan<- os.Signal) {
+	pc := ipv6.NewPacketConn(conn)
+	if err := pc.SetControlMessage(ipv6.FlagHopLimit, true); err != nil {
+		fmt.Fprintf(os.Stderr, "error enabling hop limit control messages: %s\n", err)
+	}
+	buf := make([]byte, recvBufferSize)
+	for {
+		if err := pc.SetReadDeadline(time.Now().Add(readDeadline())); err != nil {
+			fmt.Fprintf(os.Stderr, "deadline error: %s\n", err)
+			continue
+		}
+		b, cm, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				fmt.Fprintf(os.Stderr, "Request timeout\n")
+			} else {
+				fmt.Fprintf(os.Stderr, "read error: %s\n", err)
+			}
+			if *mtuDiscoverF != "" {
+				checkMTUErrQueue(conn)
+			}
+			continue
+		}
+		hopLimit := -1
+		if cm != nil {
+			hopLimit = cm.HopLimit
+		}
+		printReceivedPacketV6(buf, b, conn, hopLimit)
+		if doneReceiving() {
+			sig <- syscall.SIGQUIT
+			break
+		}
+	}
+}
+
+// doneReceiving reports whether the receiver has seen enough replies to
+// stop, per -c/-o.
+func doneReceiving() bool {
+	received := atomic.LoadInt64(&numReceived)
+	return (*countF > 0 && received >= int64(*countF)) || (*exitF && received >= 1)
+}
+
+func printReceivedPacketV4(buf []byte, bytesRead int, conn net.Conn) {
+	ihl := ipHeaderLen(buf)
+	id := getPacketID(buf, ihl)
+	// do nothing since this packet does not belong to this process
+	if int(id) != packetID {
+		return
+	}
+	atomic.AddInt64(&numReceived, 1)
+	bLen := bytesRead - ihl
+	raddr := conn.RemoteAddr().String()
+	seq := getPacketSeqNum(buf, ihl)
+	ttl := buf[8]
+	if *outputF != "json" {
+		fmt.Printf("%d bytes from %s: icmp_seq=%d ttl=%d", bLen, raddr, seq, int(ttl))
+	}
+	packTime, err := calculatePacketTime(buf[:bytesRead], ihl+icmpHeaderSize)
+	if err == nil {
+		if *outputF != "json" {
+			fmt.Printf(" time=%s\n", fmt.Sprintf("%.3fms", packTime))
+		}
+		transmissionTimes = append(transmissionTimes, packTime)
+	}
+}
+
+// printReceivedPacketV6 parses an ICMPv6 reply as delivered by the kernel:
+// no IP header, identifier/sequence/timestamp sitting at offsets 4/6/8 of
+// buf.
+func printReceivedPacketV6(buf []byte, bytesRead int, conn net.Conn, hopLimit int) {
+	id := getPacketIDV6(buf)
+	// do nothing since this packet does not belong to this process
+	if int(id) != packetID {
+		return
+	}
+	atomic.AddInt64(&numReceived, 1)
+	raddr := conn.RemoteAddr().String()
+	seq := getPacketSeqNumV6(buf)
+	if *outputF != "json" {
+		fmt.Printf("%d bytes from %s: icmp_seq=%d", bytesRead, raddr, seq)
+		if hopLimit >= 0 {
+			fmt.Printf(" ttl=%d", hopLimit)
+		}
+	}
+	packTime, err := calculatePacketTime(buf[:bytesRead], icmpHeaderSize)
+	if err == nil {
+		if *outputF != "json" {
+			fmt.Printf(" time=%s\n", fmt.Sprintf("%.3fms", packTime))
+		}
+		transmissionTimes = append(transmissionTimes, packTime)
+	} else if *outputF != "json" {
+		fmt.Println()
+	}
+}
+
+// ipHeaderLen returns the length, in bytes, of the IPv4 header in front of
+// an ICMP reply, read from the IHL (header length) field rather than
+// assumed to always be the no-options 20-byte default.
+func ipHeaderLen(buf []byte) int {
+	if len(buf) == 0 {
+		return ipHeaderSize
+	}
+	ihl := int(buf[0]&0x0f) * 4
+	if ihl < ipHeaderSize {
+		return ipHeaderSize
+	}
+	return ihl
+}
+
+func getPacketID(buf []byte, ihl int) uint16 {
+	packID := buf[ihl+4 : ihl+6]
+	id := uint16(packID[0]) << 8
+	id |= uint16(packID[1])
+	return id & 0xffff
+}
+
+func getPacketSeqNum(buf []byte, ihl int) uint16 {
+	seqNum := buf[ihl+6 : ihl+8]
+	num := uint16(seqNum[0]) << 8
+	num |= uint16(seqNum[1])
+	return num
+}
+
+func getPacketIDV6(buf []byte) uint16 {
+	packID := buf[4:6]
+	id := uint16(packID[0]) << 8
+	id |= uint16(packID[1])
+	return id & 0xffff
+}
+
+func getPacketSeqNumV6(buf []byte) uint16 {
+	seqNum := buf[6:8]
+	num := uint16(seqNum[0]) << 8
+	num |= uint16(seqNum[1])
+	return num
+}
@@ -0,0 +1,34 @@
+package main
+
+import "syscall"
+
+// setMTUDiscover sets IP_MTU_DISCOVER (IPV6_MTU_DISCOVER for v6) per -M:
+// "do" disables fragmentation, failing oversized sends with EMSGSIZE and
+// reporting mid-path MTU problems through the error queue instead of
+// fragmenting; "want" does path MTU discovery but falls back to
+// fragmentation; "dont" fragments as usual. IP_RECVERR/IPV6_RECVERR is
+// enabled alongside it so checkMTUErrQueue has something to read.
+func setMTUDiscover(fd uintptr, v6 bool, mode string) error {
+	val := syscall.IP_PMTUDISC_DONT
+	switch mode {
+	case "do":
+		val = syscall.IP_PMTUDISC_DO
+	case "want":
+		val = syscall.IP_PMTUDISC_WANT
+	}
+	proto, discoverOpt, recvErrOpt := syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_RECVERR
+	if v6 {
+		proto, discoverOpt, recvErrOpt = syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_RECVERR
+	}
+	if err := syscall.SetsockoptInt(int(fd), proto, discoverOpt, val); err != nil {
+		return err
+	}
+	return syscall.SetsockoptInt(int(fd), proto, recvErrOpt, 1)
+}
+
+// setBindToDevice implements -B via SO_BINDTODEVICE, binding the socket to
+// a single network interface so packets egress through it regardless of
+// routing table.
+func setBindToDevice(fd uintptr, iface string) error {
+	return syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+}
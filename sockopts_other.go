@@ -0,0 +1,31 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// setMTUDiscover implements -M on BSD/Darwin via IP_DONTFRAG (IPV6_DONTFRAG
+// for v6): there's no portable equivalent of Linux's IP_MTU_DISCOVER modes
+// here, just an on/off don't-fragment bit, so "do" and "want" both enable it
+// and "dont" disables it.
+func setMTUDiscover(fd uintptr, v6 bool, mode string) error {
+	val := 0
+	if mode == "do" || mode == "want" {
+		val = 1
+	}
+	proto, opt := unix.IPPROTO_IP, unix.IP_DONTFRAG
+	if v6 {
+		proto, opt = unix.IPPROTO_IPV6, unix.IPV6_DONTFRAG
+	}
+	return unix.SetsockoptInt(int(fd), proto, opt, val)
+}
+
+// setBindToDevice is a stub on non-Linux platforms: SO_BINDTODEVICE is a
+// Linux-specific sockopt.
+func setBindToDevice(fd uintptr, iface string) error {
+	return fmt.Errorf("-B is not supported on this platform")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+func printStats(destination string, ip net.IP) {
+	if *outputF == "json" {
+		printStatsJSON(destination, ip)
+		return
+	}
+	sent := atomic.LoadInt64(&numTransmitted)
+	received := atomic.LoadInt64(&numReceived)
+	fmt.Println()
+	fmt.Printf("--- %s ping statistics ---\n", destination)
+	fmt.Printf("%d packets transmitted, %d packets received, %.2f%% packet loss\n", sent, received, calculatePacketLoss(sent, received))
+	min, max, avg, stddev := calculateAverages(received)
+	fmt.Printf("round-trip min/max/avg/stddev = %.3f/%.3f/%.3f/%.3f ms\n", min, max, avg, stddev)
+}
+
+// printStatsJSON is runSingleTarget's equivalent of multiping.go's
+// targetJSON: same targetResult shape, built from the single-target run's
+// plain global counters instead of a *target, so -O json behaves the same
+// whether zing was given one destination or several.
+func printStatsJSON(destination string, ip net.IP) {
+	sent := atomic.LoadInt64(&numTransmitted)
+	received := atomic.LoadInt64(&numReceived)
+	min, max, avg, stddev := summarizeRTTs(transmissionTimes)
+	r := targetResult{
+		Destination: destination,
+		ResolvedIP:  ip.String(),
+		Sent:        sent,
+		Received:    received,
+		LossPct:     lossPct(sent, received),
+		RTTMinMs:    min,
+		RTTMaxMs:    max,
+		RTTAvgMs:    avg,
+		RTTStddevMs: stddev,
+		RTTs:        transmissionTimes,
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "zing: %s\n", err)
+		return
+	}
+	fmt.Println(string(b))
+}
+
+// calculatePacketLoss is printStats' name for lossPct (multiping.go), which
+// does the same sent/received -> percentage math for a multi-target run.
+func calculatePacketLoss(sent int64, received int64) float64 {
+	return lossPct(sent, received)
+}
+
+func calculateAverages(received int64) (float64, float64, float64, float64) {
+	var min, max, avg, stddev float64
+	if len(transmissionTimes) == 0 || received == 0 {
+		return min, max, avg, stddev
+	}
+
+	min = transmissionTimes[0]
+	max = transmissionTimes[0]
+	var sum float64
+	for _, t := range transmissionTimes {
+		sum += t
+		if t < min {
+			min = t
+		}
+		if t > max {
+			max = t
+		}
+	}
+	avg = sum / float64(received)
+
+	// calculate standard deviation
+	var variance float64
+	for _, t := range transmissionTimes {
+		diff := t - avg
+		diff = diff * diff
+		variance += diff
+	}
+	stddev = math.Sqrt(variance / float64(received))
+	return min, max, avg, stddev
+}
+
+// calculatePacketTime reads the 8-byte big-endian UnixNano timestamp that
+// buildInto placed at the start of the payload and returns the elapsed
+// time since then, in milliseconds. payloadOffset is where the ICMP
+// payload starts in buf: right after the (variable-length) IPv4 header for
+// v4 replies, or right after the ICMP header for a raw v6 recv with no IP
+// header at all. Callers must slice buf down to the number of bytes the
+// kernel actually delivered first: buf itself is a reused receive buffer,
+// so anything past that point is stale data from a previous read, not part
+// of this reply.
+func calculatePacketTime(buf []byte, payloadOffset int) (float64, error) {
+	if len(buf) < payloadOffset+timestampSize {
+		return 0.0, fmt.Errorf("reply too short to contain a timestamp")
+	}
+	sent := int64(binary.BigEndian.Uint64(buf[payloadOffset : payloadOffset+timestampSize]))
+	now := time.Now().UnixNano()
+	return float64(now-sent) / 1000000.00, nil
+}
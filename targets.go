@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+// maxCIDRHosts bounds how many hosts a single CIDR argument may expand to.
+// runMultiTarget spawns one goroutine and one *target per resolved host, so
+// an unbounded range (a typo'd prefix length, or an honest /8) would turn
+// into a local resource-exhaustion incident rather than just a slow ping.
+const maxCIDRHosts = 1024
+
+// target tracks per-destination state for a multi-target run. Singe-target
+// runs use the plain global counters instead (see runSingleTarget).
+type target struct {
+	label string // what the user typed: a hostname or an address from a CIDR range
+	ip    net.IP
+	isV6  bool
+
+	sent     int64
+	received int64
+
+	timesMu sync.Mutex
+	times   []float64
+
+	done chan struct{}
+}
+
+func newTarget(label string, ip net.IP) *target {
+	return &target{
+		label: label,
+		ip:    ip,
+		isV6:  isIPv6(ip),
+		done:  make(chan struct{}),
+	}
+}
+
+// resolveTargets expands the command line arguments into concrete targets.
+// A CIDR argument like 10.0.0.0/24 is enumerated host by host; anything
+// else is resolved through DNS exactly like a single-target invocation.
+// Two arguments resolving to the same address are deduplicated: multi-target
+// mode demultiplexes replies by source address on a shared socket, so a
+// duplicate target would never receive its own replies and would hang
+// -c/-o forever waiting for them.
+func resolveTargets(args []string) ([]*target, error) {
+	var targets []*target
+	seen := make(map[string]*target)
+	addTarget := func(label string, ip net.IP) {
+		key := ip.String()
+		if existing, ok := seen[key]; ok {
+			fmt.Fprintf(os.Stderr, "zing: skipping %s, same address as %s (%s)\n", label, existing.label, key)
+			return
+		}
+		t := newTarget(label, ip)
+		seen[key] = t
+		targets = append(targets, t)
+	}
+	for _, a := range args {
+		if ip, ipnet, err := net.ParseCIDR(a); err == nil {
+			n, err := cidrHostCount(ipnet)
+			if err != nil {
+				return nil, err
+			}
+			if n > maxCIDRHosts {
+				return nil, fmt.Errorf("%s expands to %d hosts, which exceeds the %d host limit per CIDR argument", a, n, maxCIDRHosts)
+			}
+			for _, host := range hostsInCIDR(ip, ipnet) {
+				addTarget(host.String(), host)
+			}
+			continue
+		}
+
+		addrs, err := net.LookupHost(a)
+		if err != nil {
+			return nil, fmt.Errorf("lookup for %s failed", a)
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no addresses were found for %s", a)
+		}
+		ip, err := getIPAddr(addrs)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving address for %s: %s", a, err)
+		}
+		addTarget(a, ip)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets to ping")
+	}
+	return targets, nil
+}
+
+// cidrHostCount returns how many addresses ipnet contains, checked against
+// maxCIDRHosts before hostsInCIDR ever enumerates them: hostBits is capped
+// at 32 here purely so the shift below can't overflow, since any mask that
+// loose is already far past maxCIDRHosts.
+func cidrHostCount(ipnet *net.IPNet) (uint64, error) {
+	ones, bits := ipnet.Mask.Size()
+	if bits == 0 {
+		return 0, fmt.Errorf("invalid network mask")
+	}
+	hostBits := bits - ones
+	if hostBits > 32 {
+		hostBits = 32
+	}
+	return uint64(1) << uint(hostBits), nil
+}
+
+// hostsInCIDR enumerates every usable host address in the given network. For
+// IPv4 ranges with more than two addresses, the network and broadcast
+// addresses are skipped since they are not pingable hosts.
+func hostsInCIDR(ip net.IP, ipnet *net.IPNet) []net.IP {
+	var hosts []net.IP
+	for cur := cloneIP(ipnet.IP.Mask(ipnet.Mask)); ipnet.Contains(cur); incIP(cur) {
+		hosts = append(hosts, cloneIP(cur))
+	}
+	if ipnet.IP.To4() != nil && len(hosts) > 2 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts
+}
+
+func cloneIP(ip net.IP) net.IP {
+	c := make(net.IP, len(ip))
+	copy(c, ip)
+	return c
+}
+
+func incIP(ip net.IP) {
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]++
+		if ip[i] != 0 {
+			return
+		}
+	}
+}